@@ -0,0 +1,144 @@
+// Package iconformat sniffs the true format and pixel dimensions of a
+// downloaded favicon body, independent of whatever Content-Type header the
+// server claimed. Sites routinely serve HTML error pages with an image
+// Content-Type, or serve `/favicon.ico` paths that are actually PNGs.
+package iconformat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// ErrUnrecognizedFormat is returned when the body does not decode as any
+// known icon format.
+var ErrUnrecognizedFormat = errors.New("iconformat: unrecognized image format")
+
+var icoMagic = []byte{0x00, 0x00, 0x01, 0x00}
+
+// Format describes a detected icon's true file extension and pixel size.
+// Width and Height are 0 for vector formats (SVG).
+type Format struct {
+	Ext    string
+	Width  int
+	Height int
+}
+
+// Detect inspects the first bytes of body to determine its real format and
+// dimensions, trying SVG, ICO, then the registered raster image decoders
+// (png, jpeg, gif, webp) in turn.
+// @param body Raw response body as downloaded.
+// @return Detected format, or ErrUnrecognizedFormat if body does not look
+// like a valid icon.
+func Detect(body []byte) (Format, error) {
+	if looksLikeSVG(body) {
+		return Format{Ext: "svg"}, nil
+	}
+
+	if bytes.HasPrefix(body, icoMagic) {
+		width, height, err := decodeICODimensions(body)
+		if err != nil {
+			return Format{}, err
+		}
+		return Format{Ext: "ico", Width: width, Height: height}, nil
+	}
+
+	config, formatName, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		return Format{}, ErrUnrecognizedFormat
+	}
+	ext := formatName
+	if ext == "jpeg" {
+		ext = "jpg"
+	}
+	return Format{Ext: ext, Width: config.Width, Height: config.Height}, nil
+}
+
+// looksLikeSVG reports whether body parses as well-formed XML whose root
+// element is <svg>.
+func looksLikeSVG(body []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local == "svg"
+		}
+	}
+}
+
+// decodeICODimensions finds the largest embedded image's dimensions in an
+// ICO directory, since the standard library has no ICO decoder to report
+// them for us.
+func decodeICODimensions(body []byte) (int, int, error) {
+	entries, err := ParseDirectory(body)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	bestWidth, bestHeight := 0, 0
+	for _, entry := range entries {
+		if entry.Width*entry.Height > bestWidth*bestHeight {
+			bestWidth, bestHeight = entry.Width, entry.Height
+		}
+	}
+	return bestWidth, bestHeight, nil
+}
+
+// DirectoryEntry is one entry of an ICO/CUR directory: an embedded image's
+// native pixel size, plus the offset and size of its encoded data within the
+// file (a PNG for modern icons, or a legacy AND-masked DIB with no standalone
+// file header).
+type DirectoryEntry struct {
+	Width, Height int
+	DataSize      uint32
+	DataOffset    uint32
+}
+
+// ParseDirectory hand-parses an ICO/CUR directory: a 6 byte header followed
+// by a 16 byte entry per embedded image, since the standard library has no
+// ICO decoder to lean on for this. A width/height byte of 0 means 256px.
+func ParseDirectory(body []byte) ([]DirectoryEntry, error) {
+	const headerSize = 6
+	const entrySize = 16
+
+	if len(body) < headerSize+entrySize {
+		return nil, ErrUnrecognizedFormat
+	}
+	count := int(body[4]) | int(body[5])<<8
+
+	var entries []DirectoryEntry
+	for i := 0; i < count; i++ {
+		offset := headerSize + i*entrySize
+		if offset+entrySize > len(body) {
+			break
+		}
+		width := int(body[offset])
+		if width == 0 {
+			width = 256
+		}
+		height := int(body[offset+1])
+		if height == 0 {
+			height = 256
+		}
+		dataSize := binary.LittleEndian.Uint32(body[offset+8 : offset+12])
+		dataOffset := binary.LittleEndian.Uint32(body[offset+12 : offset+16])
+		if int(dataOffset)+int(dataSize) > len(body) {
+			continue
+		}
+		entries = append(entries, DirectoryEntry{Width: width, Height: height, DataSize: dataSize, DataOffset: dataOffset})
+	}
+	if len(entries) == 0 {
+		return nil, ErrUnrecognizedFormat
+	}
+	return entries, nil
+}
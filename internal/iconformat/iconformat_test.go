@@ -0,0 +1,119 @@
+package iconformat
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// icoDirEntry mirrors the on-disk layout of a single ICO directory entry, for
+// building test fixtures byte-by-byte.
+type icoDirEntry struct {
+	width, height        byte
+	dataSize, dataOffset uint32
+}
+
+// buildICO assembles a minimal ICO file: a 6 byte header followed by one
+// 16 byte directory entry per entries. The referenced image data is never
+// written (ParseDirectory only reads the directory), so dataOffset/dataSize
+// just need to stay within totalSize for the bounds check to pass.
+func buildICO(entries []icoDirEntry, totalSize int) []byte {
+	body := make([]byte, totalSize)
+	binary.LittleEndian.PutUint16(body[0:2], 0)          // reserved
+	binary.LittleEndian.PutUint16(body[2:4], 1)           // type: icon
+	binary.LittleEndian.PutUint16(body[4:6], uint16(len(entries)))
+
+	for i, entry := range entries {
+		offset := 6 + i*16
+		body[offset] = entry.width
+		body[offset+1] = entry.height
+		binary.LittleEndian.PutUint32(body[offset+8:offset+12], entry.dataSize)
+		binary.LittleEndian.PutUint32(body[offset+12:offset+16], entry.dataOffset)
+	}
+	return body
+}
+
+func TestParseDirectory_TruncatedHeader(t *testing.T) {
+	_, err := ParseDirectory([]byte{0x00, 0x00, 0x01, 0x00})
+	if err != ErrUnrecognizedFormat {
+		t.Fatalf("expected ErrUnrecognizedFormat for a truncated directory, got %v", err)
+	}
+}
+
+func TestParseDirectory_ZeroCount(t *testing.T) {
+	// Large enough to pass the length check, but with a count of 0 entries.
+	body := buildICO(nil, 6+16)
+	if _, err := ParseDirectory(body); err != ErrUnrecognizedFormat {
+		t.Fatalf("expected ErrUnrecognizedFormat for a zero-count directory, got %v", err)
+	}
+}
+
+func TestParseDirectory_ZeroByteMeans256(t *testing.T) {
+	body := buildICO([]icoDirEntry{{width: 0, height: 0, dataSize: 0, dataOffset: 0}}, 6+16)
+	entries, err := ParseDirectory(body)
+	if err != nil {
+		t.Fatalf("ParseDirectory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].Width != 256 || entries[0].Height != 256 {
+		t.Fatalf("expected a 0 size byte to mean 256px, got %dx%d", entries[0].Width, entries[0].Height)
+	}
+}
+
+func TestParseDirectory_SkipsEntryWithOutOfBoundsData(t *testing.T) {
+	body := buildICO([]icoDirEntry{
+		{width: 16, height: 16, dataSize: 1000, dataOffset: 1000}, // out of bounds, dropped
+		{width: 32, height: 32, dataSize: 10, dataOffset: 6 + 32}, // fits, kept
+	}, 6+32+10)
+	entries, err := ParseDirectory(body)
+	if err != nil {
+		t.Fatalf("ParseDirectory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the in-bounds entry to survive, got %d entries", len(entries))
+	}
+	if entries[0].Width != 32 {
+		t.Fatalf("expected the surviving entry to be the 32x32 one, got width %d", entries[0].Width)
+	}
+}
+
+func TestParseDirectory_AllEntriesOutOfBounds(t *testing.T) {
+	body := buildICO([]icoDirEntry{{width: 16, height: 16, dataSize: 1000, dataOffset: 1000}}, 6+16)
+	if _, err := ParseDirectory(body); err != ErrUnrecognizedFormat {
+		t.Fatalf("expected ErrUnrecognizedFormat when every entry is out of bounds, got %v", err)
+	}
+}
+
+func TestDetect_SVG(t *testing.T) {
+	format, err := Detect([]byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`))
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if format.Ext != "svg" {
+		t.Fatalf("expected ext svg, got %q", format.Ext)
+	}
+}
+
+func TestDetect_ICODimensions(t *testing.T) {
+	body := buildICO([]icoDirEntry{
+		{width: 16, height: 16, dataSize: 0, dataOffset: 0},
+		{width: 32, height: 32, dataSize: 0, dataOffset: 0},
+	}, 6+32)
+	format, err := Detect(body)
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if format.Ext != "ico" {
+		t.Fatalf("expected ext ico, got %q", format.Ext)
+	}
+	if format.Width != 32 || format.Height != 32 {
+		t.Fatalf("expected the largest entry (32x32) to be reported, got %dx%d", format.Width, format.Height)
+	}
+}
+
+func TestDetect_TruncatedICOIsUnrecognized(t *testing.T) {
+	if _, err := Detect([]byte{0x00, 0x00, 0x01, 0x00}); err != ErrUnrecognizedFormat {
+		t.Fatalf("expected ErrUnrecognizedFormat for a truncated ICO, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Package manifest writes the structured, append-only record of every
+// scrape attempt (manifest.jsonl) plus a single run-summary.json, so
+// downstream consumers can join favicons back to HN stories or diff runs
+// without having to infer anything from filenames on disk.
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is one line of manifest.jsonl, describing a single domain's scrape outcome.
+type Record struct {
+	OriginalURL string `json:"original_url"`
+	Domain      string `json:"domain"`
+	FinalURL    string `json:"final_url"`
+	HTTPStatus  int    `json:"http_status"`
+	ContentType string `json:"content_type"`
+	ByteSize    int    `json:"byte_size"`
+	SHA256      string `json:"sha256,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+
+	SourceMethod string `json:"source_method"`
+	// Status is one of "succeeded", "failed", or "unchanged", so a manifest
+	// line always records an outcome, not just the successes.
+	Status     string    `json:"status"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	ScrapedAt  time.Time `json:"scraped_at"`
+}
+
+// Writer appends Records to manifest.jsonl. Safe for concurrent use, since
+// colly invokes response callbacks from multiple goroutines.
+type Writer struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Create opens (appending to, if it already exists) the manifest file at path.
+func Create(path string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Append writes record as the next line of the manifest.
+func (w *Writer) Append(record Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(record)
+}
+
+// Close closes the underlying file.
+func (w *Writer) Close() error {
+	return w.file.Close()
+}
+
+// Summary is the run-summary.json written once at the end of a run.
+type Summary struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Entries    int       `json:"entries"`
+	Duplicates int       `json:"duplicates"`
+	Rows       int       `json:"rows"`
+	Planned    int       `json:"planned"`
+	Succeeded  int       `json:"succeeded"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Unchanged  int       `json:"unchanged"`
+}
+
+// WriteSummary writes summary as a single JSON document at path, overwriting
+// any prior run-summary.json.
+func WriteSummary(path string, summary Summary) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,200 @@
+// Package normalize turns a freshly scraped favicon, in whatever format it
+// was found, into a set of uniform-size raster derivatives (PNG and/or
+// WebP) so downstream UIs don't each have to reimplement icon decoding.
+package normalize
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	ico "github.com/biessek/golang-ico"
+	"github.com/chai2010/webp"
+	"github.com/ijsf/bra-cat.favicon-collector/internal/iconformat"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+var pngMagic = []byte{0x89, 0x50, 0x4E, 0x47}
+
+// Options controls which derivatives Run produces.
+type Options struct {
+	// Sizes is the set of target square sizes, in pixels, to render.
+	Sizes []int
+	// Formats is the set of output formats to encode each size as ("png", "webp").
+	Formats []string
+}
+
+// Run decodes the icon at sourcePath (whose format is identified by
+// sourceExt, e.g. "png", "ico", "svg") and writes Options.Sizes x
+// Options.Formats derivatives under outputRoot, as <size>/<domain>.<format>.
+// @param domain Sanitized domain the icon belongs to, used as the derivative filename.
+// @param sourcePath Path to the originally scraped icon file.
+// @param sourceExt Detected format of sourcePath, as returned by iconformat.Detect.
+// @param outputRoot Base output directory (the same one originals are stored under).
+// @return Error if the source could not be decoded; individual derivative write
+// failures are collected and returned as a combined error after best-effort continuing.
+func Run(domain string, sourcePath string, sourceExt string, outputRoot string, opts Options) error {
+	body, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return fmt.Errorf("normalize: reading source: %w", err)
+	}
+
+	var errs []error
+	for _, size := range opts.Sizes {
+		resized, err := render(body, sourceExt, size)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("normalize: rendering %dpx: %w", size, err))
+			continue
+		}
+		for _, format := range opts.Formats {
+			if err := writeDerivative(resized, domain, outputRoot, size, format); err != nil {
+				errs = append(errs, fmt.Errorf("normalize: writing %dpx %s: %w", size, format, err))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("normalize: %d derivative(s) failed: %v", len(errs), errs)
+	}
+	return nil
+}
+
+// render decodes source at the given size, rasterizing SVGs directly at the
+// target size and downscaling/upscaling raster formats with a high quality filter.
+func render(body []byte, sourceExt string, size int) (image.Image, error) {
+	if sourceExt == "svg" {
+		return rasterizeSVG(body, size)
+	}
+
+	src, err := decodeRaster(body, sourceExt, size)
+	if err != nil {
+		return nil, err
+	}
+	if src.Bounds().Dx() == size && src.Bounds().Dy() == size {
+		return src, nil
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+	return dst, nil
+}
+
+// decodeRaster decodes a non-vector icon, special-casing ICO (which the
+// standard library cannot decode on its own) and otherwise deferring to the
+// decoders registered via blank import (png, jpeg, gif, webp).
+func decodeRaster(body []byte, sourceExt string, targetSize int) (image.Image, error) {
+	if sourceExt == "ico" {
+		return decodeICO(body, targetSize)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// decodeICO picks the embedded image whose native size is the closest fit
+// for targetSize (preferring the smallest one at or above targetSize, so we
+// downscale rather than upscale wherever the ICO offers the choice), then
+// decodes just that entry. Falls back to the package's default single-image
+// decode if the directory can't be parsed or the chosen entry isn't a format
+// the standard decoders recognize (e.g. a legacy AND-masked DIB).
+func decodeICO(body []byte, targetSize int) (image.Image, error) {
+	entries, err := iconformat.ParseDirectory(body)
+	if err != nil {
+		return ico.Decode(bytes.NewReader(body))
+	}
+
+	best := entries[0]
+	for _, entry := range entries[1:] {
+		if closerToTarget(entry, best, targetSize) {
+			best = entry
+		}
+	}
+
+	data := body[best.DataOffset : best.DataOffset+best.DataSize]
+	if bytes.HasPrefix(data, pngMagic) {
+		if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			return img, nil
+		}
+	}
+
+	// Legacy BMP-backed entry (no file header, possibly AND-masked): the
+	// standalone decoders above can't handle it, so fall back to whatever
+	// the whole-file decoder picks and let the caller scale from there.
+	return ico.Decode(bytes.NewReader(body))
+}
+
+// closerToTarget reports whether candidate is a better fit than current for
+// targetSize: the smallest native size that still covers targetSize wins
+// (least downscaling); failing that, the largest available size wins
+// (least upscaling).
+func closerToTarget(candidate, current iconformat.DirectoryEntry, targetSize int) bool {
+	candidateSize := candidate.Width
+	if candidate.Height > candidateSize {
+		candidateSize = candidate.Height
+	}
+	currentSize := current.Width
+	if current.Height > currentSize {
+		currentSize = current.Height
+	}
+
+	candidateCovers := candidateSize >= targetSize
+	currentCovers := currentSize >= targetSize
+	if candidateCovers != currentCovers {
+		return candidateCovers
+	}
+	if candidateCovers {
+		return candidateSize < currentSize
+	}
+	return candidateSize > currentSize
+}
+
+// rasterizeSVG renders an SVG document into a size x size RGBA image.
+func rasterizeSVG(body []byte, size int) (image.Image, error) {
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	icon.SetTarget(0, 0, float64(size), float64(size))
+
+	rgba := image.NewRGBA(image.Rect(0, 0, size, size))
+	scanner := rasterx.NewScannerGV(size, size, rgba, rgba.Bounds())
+	raster := rasterx.NewDasher(size, size, scanner)
+	icon.Draw(raster, 1.0)
+	return rgba, nil
+}
+
+// writeDerivative encodes img in the given format and writes it to
+// <outputRoot>/<size>/<domain>.<format>, creating the size subdirectory as needed.
+func writeDerivative(img image.Image, domain string, outputRoot string, size int, format string) error {
+	dir := filepath.Join(outputRoot, fmt.Sprintf("%d", size))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, domain+"."+format)
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch format {
+	case "png":
+		return png.Encode(file, img)
+	case "webp":
+		return webp.Encode(file, img, &webp.Options{Lossless: false, Quality: 90})
+	default:
+		return fmt.Errorf("unsupported normalized format %q", format)
+	}
+}
@@ -0,0 +1,130 @@
+package normalize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/ijsf/bra-cat.favicon-collector/internal/iconformat"
+)
+
+func TestCloserToTarget(t *testing.T) {
+	const targetSize = 32
+
+	cases := []struct {
+		name      string
+		candidate iconformat.DirectoryEntry
+		current   iconformat.DirectoryEntry
+		want      bool
+	}{
+		{
+			name:      "smaller-but-still-covering wins over larger-covering",
+			candidate: iconformat.DirectoryEntry{Width: 32, Height: 32},
+			current:   iconformat.DirectoryEntry{Width: 48, Height: 48},
+			want:      true,
+		},
+		{
+			name:      "exact target size covers and beats an oversized entry",
+			candidate: iconformat.DirectoryEntry{Width: targetSize, Height: targetSize},
+			current:   iconformat.DirectoryEntry{Width: 64, Height: 64},
+			want:      true,
+		},
+		{
+			name:      "covering entry always beats a non-covering one",
+			candidate: iconformat.DirectoryEntry{Width: 32, Height: 32},
+			current:   iconformat.DirectoryEntry{Width: 16, Height: 16},
+			want:      true,
+		},
+		{
+			name:      "among non-covering entries, the larger one wins",
+			candidate: iconformat.DirectoryEntry{Width: 24, Height: 24},
+			current:   iconformat.DirectoryEntry{Width: 16, Height: 16},
+			want:      true,
+		},
+		{
+			name:      "smaller non-covering entry loses",
+			candidate: iconformat.DirectoryEntry{Width: 16, Height: 16},
+			current:   iconformat.DirectoryEntry{Width: 24, Height: 24},
+			want:      false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := closerToTarget(c.candidate, c.current, targetSize); got != c.want {
+				t.Fatalf("closerToTarget(%+v, %+v, %d) = %v, want %v", c.candidate, c.current, targetSize, got, c.want)
+			}
+		})
+	}
+}
+
+// buildICOWithPNGEntry assembles an ICO file containing a single directory
+// entry whose data is a real, decodable PNG, to exercise decodeICO's
+// PNG-backed entry path.
+func buildICOWithPNGEntry(t *testing.T, size int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var pngBuf bytes.Buffer
+	if err := png.Encode(&pngBuf, img); err != nil {
+		t.Fatalf("encoding fixture PNG: %v", err)
+	}
+	pngBytes := pngBuf.Bytes()
+
+	const headerSize = 6
+	const entrySize = 16
+	dataOffset := headerSize + entrySize
+	body := make([]byte, dataOffset+len(pngBytes))
+	binary.LittleEndian.PutUint16(body[2:4], 1) // type: icon
+	binary.LittleEndian.PutUint16(body[4:6], 1) // one entry
+	body[headerSize] = byte(size)
+	body[headerSize+1] = byte(size)
+	binary.LittleEndian.PutUint32(body[headerSize+8:headerSize+12], uint32(len(pngBytes)))
+	binary.LittleEndian.PutUint32(body[headerSize+12:headerSize+16], uint32(dataOffset))
+	copy(body[dataOffset:], pngBytes)
+	return body
+}
+
+func TestDecodeICO_PNGBackedEntry(t *testing.T) {
+	body := buildICOWithPNGEntry(t, 32)
+	img, err := decodeICO(body, 32)
+	if err != nil {
+		t.Fatalf("decodeICO: %v", err)
+	}
+	if img.Bounds().Dx() != 32 || img.Bounds().Dy() != 32 {
+		t.Fatalf("expected the decoded PNG-backed entry to be 32x32, got %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+}
+
+func TestDecodeICO_BMPBackedEntryFallsBackWithoutPanicking(t *testing.T) {
+	// A directory entry whose data doesn't start with the PNG magic bytes
+	// simulates a legacy AND-masked DIB entry, which decodeICO can't decode
+	// standalone; it should fall back to the whole-file decoder and return
+	// an error (this fixture isn't a complete legacy ICO), not panic.
+	const headerSize = 6
+	const entrySize = 16
+	dibData := bytes.Repeat([]byte{0x00}, 40) // plausible BITMAPINFOHEADER size, garbage content
+	dataOffset := headerSize + entrySize
+	body := make([]byte, dataOffset+len(dibData))
+	binary.LittleEndian.PutUint16(body[2:4], 1)
+	binary.LittleEndian.PutUint16(body[4:6], 1)
+	body[headerSize] = 16
+	body[headerSize+1] = 16
+	binary.LittleEndian.PutUint32(body[headerSize+8:headerSize+12], uint32(len(dibData)))
+	binary.LittleEndian.PutUint32(body[headerSize+12:headerSize+16], uint32(dataOffset))
+	copy(body[dataOffset:], dibData)
+
+	if _, err := decodeICO(body, 16); err == nil {
+		t.Fatalf("expected an error falling back on an undecodable legacy entry, got nil")
+	}
+}
+
+func TestDecodeICO_UnparseableDirectoryFallsBackWithoutPanicking(t *testing.T) {
+	if _, err := decodeICO([]byte{0x00, 0x00, 0x01, 0x00}, 32); err == nil {
+		t.Fatalf("expected an error for a truncated directory, got nil")
+	}
+}
@@ -0,0 +1,210 @@
+// Package queue implements a persistent, resumable record of per-domain
+// scrape state so that large HN dumps can be scraped across multiple runs
+// and crashes without redoing work or hammering domains that are known dead.
+// It also carries the HTTP caching metadata (ETag, Last-Modified, body hash)
+// needed to cheaply re-check previously scraped domains for changes.
+package queue
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Status describes where a domain is in the scrape lifecycle.
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusInFlight  Status = "in_flight"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// maxBackoffShift caps the exponential backoff applied to repeatedly failing
+// domains at 2^maxBackoffShift times the configured cooldown.
+const maxBackoffShift = 4
+
+var domainsBucket = []byte("domains")
+
+// Record is the persisted state for a single domain.
+type Record struct {
+	Domain       string    `json:"domain"`
+	Status       Status    `json:"status"`
+	ErrorClass   string    `json:"error_class,omitempty"`
+	FailureCount int       `json:"failure_count,omitempty"`
+	LastAttempt  time.Time `json:"last_attempt"`
+	LastChecked  time.Time `json:"last_checked,omitempty"`
+
+	// HTTP caching metadata from the most recent successful fetch, used to
+	// make --refresh re-checks conditional.
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	FinalURL     string `json:"final_url,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+}
+
+// Store is a bbolt-backed persistent queue of domain scrape state.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens (creating if necessary) the queue database at path.
+// @param path Filesystem path to the bbolt database file.
+// @return Store ready for use, or an error if the database could not be opened.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(domainsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the underlying database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Get returns the current record for domain, if one exists.
+func (s *Store) Get(domain string) (Record, bool, error) {
+	var record Record
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(domainsBucket).Get([]byte(domain))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &record)
+	})
+	return record, found, err
+}
+
+// update loads domain's existing record (or a fresh zero-value one), applies
+// mutate, and persists the result. All state transitions go through this so
+// that fields a given transition doesn't care about (e.g. cache metadata
+// during a plain MarkFailed) are preserved rather than clobbered.
+func (s *Store) update(domain string, mutate func(*Record)) error {
+	record, _, err := s.Get(domain)
+	if err != nil {
+		return err
+	}
+	record.Domain = domain
+	mutate(&record)
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(domainsBucket).Put([]byte(domain), data)
+	})
+}
+
+// MarkPending records that domain is queued for a scrape attempt.
+func (s *Store) MarkPending(domain string) error {
+	return s.update(domain, func(r *Record) {
+		r.Status = StatusPending
+	})
+}
+
+// MarkInFlight records that a scrape for domain has been issued to the collector.
+func (s *Store) MarkInFlight(domain string) error {
+	return s.update(domain, func(r *Record) {
+		r.Status = StatusInFlight
+		r.LastAttempt = time.Now()
+	})
+}
+
+// MarkSucceeded records that domain was scraped successfully, storing the
+// HTTP caching metadata of the response so a later --refresh run can issue a
+// conditional request instead of redownloading unconditionally.
+func (s *Store) MarkSucceeded(domain string, meta FetchMetadata) error {
+	return s.update(domain, func(r *Record) {
+		now := time.Now()
+		r.Status = StatusSucceeded
+		r.ErrorClass = ""
+		r.FailureCount = 0
+		r.LastAttempt = now
+		r.LastChecked = now
+		r.ETag = meta.ETag
+		r.LastModified = meta.LastModified
+		r.FinalURL = meta.FinalURL
+		r.SHA256 = meta.SHA256
+	})
+}
+
+// MarkUnchanged records that a --refresh re-check of domain found the icon
+// unchanged (either a 304 response, or a 200 whose body hash matched): the
+// stored cache metadata is kept, the domain is marked succeeded with its
+// failure state cleared, and the last-attempt and last-checked timestamps
+// are bumped.
+func (s *Store) MarkUnchanged(domain string) error {
+	return s.update(domain, func(r *Record) {
+		now := time.Now()
+		r.Status = StatusSucceeded
+		r.ErrorClass = ""
+		r.FailureCount = 0
+		r.LastAttempt = now
+		r.LastChecked = now
+	})
+}
+
+// MarkFailed records that domain permanently failed with the given error
+// class, incrementing its failure count for backoff purposes.
+func (s *Store) MarkFailed(domain string, errorClass string) error {
+	return s.update(domain, func(r *Record) {
+		r.Status = StatusFailed
+		r.ErrorClass = errorClass
+		r.FailureCount = r.FailureCount + 1
+		r.LastAttempt = time.Now()
+	})
+}
+
+// FetchMetadata is the HTTP caching information captured from a successful fetch.
+type FetchMetadata struct {
+	ETag         string
+	LastModified string
+	FinalURL     string
+	SHA256       string
+}
+
+// ShouldSkip reports whether domain should be skipped this run: it already
+// succeeded (whatever the --refresh setting, which this function does not
+// see), or it failed recently, within a cooldown that grows exponentially
+// with repeated failures. A cooldown of 0 or less skips failed domains for good.
+func (s *Store) ShouldSkip(domain string, cooldown time.Duration) (bool, error) {
+	record, found, err := s.Get(domain)
+	if err != nil || !found {
+		return false, err
+	}
+	switch record.Status {
+	case StatusSucceeded:
+		return true, nil
+	case StatusFailed:
+		if cooldown <= 0 {
+			return true, nil
+		}
+		shift := record.FailureCount - 1
+		if shift < 0 {
+			shift = 0
+		}
+		if shift > maxBackoffShift {
+			shift = maxBackoffShift
+		}
+		backoff := cooldown * time.Duration(int64(1)<<uint(shift))
+		return time.Since(record.LastAttempt) < backoff, nil
+	default:
+		// Pending or in-flight from a prior, possibly crashed, run: resume it.
+		return false, nil
+	}
+}
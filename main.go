@@ -5,15 +5,17 @@ package main
 */
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"os"
-	"io/fs"
 	"time"
 	"net/url"
 	"net/http"
+	"strconv"
 	"strings"
 	"path/filepath"
-	"errors"
 	"regexp"
 	"fmt"
 
@@ -21,6 +23,12 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/gocolly/colly/v2"
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/ijsf/bra-cat.favicon-collector/internal/iconformat"
+	"github.com/ijsf/bra-cat.favicon-collector/internal/manifest"
+	"github.com/ijsf/bra-cat.favicon-collector/internal/normalize"
+	"github.com/ijsf/bra-cat.favicon-collector/internal/queue"
 
 	"github.com/sirupsen/logrus"
 )
@@ -60,6 +68,273 @@ func extractSanitizedDomainFromURL(requestURL string) string {
 	return domain
 }
 
+// A candidate icon URL discovered while parsing a page's HTML.
+type iconCandidate struct {
+	URL    string
+	Width  int
+	Height int
+	Type   string // "svg", "png", "ico", or "other"
+	Source string // "link-icon" or "meta-tile", for the manifest's source_method field
+}
+
+// Returns a relative preference ranking for an icon type, higher is better.
+func iconTypePriority(iconType string) int {
+	switch iconType {
+	case "svg":
+		return 3
+	case "png":
+		return 2
+	case "ico":
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Determines the icon type from its URL extension and/or MIME type attribute.
+func iconTypeFromURL(rawURL string, mimeType string) string {
+	switch {
+	case strings.Contains(mimeType, "svg"):
+		return "svg"
+	case strings.Contains(mimeType, "png"):
+		return "png"
+	case strings.Contains(mimeType, "icon") || strings.Contains(mimeType, "ico"):
+		return "ico"
+	case strings.HasSuffix(rawURL, ".svg"):
+		return "svg"
+	case strings.HasSuffix(rawURL, ".png"):
+		return "png"
+	case strings.HasSuffix(rawURL, ".ico"):
+		return "ico"
+	default:
+		return "other"
+	}
+}
+
+// Parses a `sizes="WxH"` link attribute, e.g. "32x32". Returns 0,0 if absent or "any".
+func parseSizesAttr(sizes string) (int, int) {
+	if sizes == "" || strings.EqualFold(sizes, "any") {
+		return 0, 0
+	}
+	parts := strings.SplitN(strings.ToLower(sizes), "x", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	width, errWidth := strconv.Atoi(strings.TrimSpace(parts[0]))
+	height, errHeight := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if errWidth != nil || errHeight != nil {
+		return 0, 0
+	}
+	return width, height
+}
+
+// Resolves a possibly-relative icon reference against the page's base URL.
+func resolveIconURL(base *url.URL, ref string) string {
+	refURL, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ""
+	}
+	return base.ResolveReference(refURL).String()
+}
+
+// Scans an HTML document body for icon link/meta tags and returns every candidate found.
+// @param body Raw HTML body.
+// @param baseURL The URL the body was fetched from, used to resolve relative hrefs.
+// @return Slice of discovered icon candidates, possibly empty.
+func parseIconCandidates(body []byte, baseURL *url.URL) []iconCandidate {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+
+	var candidates []iconCandidate
+
+	doc.Find(`link[rel="icon"], link[rel="shortcut icon"], link[rel="apple-touch-icon"]`).Each(func(_ int, s *goquery.Selection) {
+		href, ok := s.Attr("href")
+		if !ok || href == "" {
+			return
+		}
+		resolved := resolveIconURL(baseURL, href)
+		if resolved == "" {
+			return
+		}
+		width, height := parseSizesAttr(s.AttrOr("sizes", ""))
+		candidates = append(candidates, iconCandidate{
+			URL:    resolved,
+			Width:  width,
+			Height: height,
+			Type:   iconTypeFromURL(resolved, s.AttrOr("type", "")),
+			Source: "link-icon",
+		})
+	})
+
+	doc.Find(`meta[name="msapplication-TileImage"]`).Each(func(_ int, s *goquery.Selection) {
+		content, ok := s.Attr("content")
+		if !ok || content == "" {
+			return
+		}
+		resolved := resolveIconURL(baseURL, content)
+		if resolved == "" {
+			return
+		}
+		candidates = append(candidates, iconCandidate{
+			URL:    resolved,
+			Type:   iconTypeFromURL(resolved, ""),
+			Source: "meta-tile",
+		})
+	})
+
+	return candidates
+}
+
+// Picks the best icon out of a set of candidates: prefer candidates at or above
+// targetSize, then the largest size, breaking ties by type preference (svg > png > ico).
+// @param candidates Discovered icon candidates.
+// @param targetSize Minimum desired size (largest dimension, in pixels).
+// @return The best candidate, or nil if candidates is empty.
+func selectBestIconCandidate(candidates []iconCandidate, targetSize int) *iconCandidate {
+	var best *iconCandidate
+	bestScore := -1
+	for i := range candidates {
+		candidate := &candidates[i]
+		size := candidate.Width
+		if candidate.Height > size {
+			size = candidate.Height
+		}
+		// Size outranks type; the type preference only breaks ties between equal sizes.
+		score := size*10 + iconTypePriority(candidate.Type)
+		// A candidate with no usable size (no `sizes` attribute, or `sizes="any"`,
+		// as is typical for an SVG icon) is scalable and should satisfy the target
+		// just as much as a raster icon that explicitly reports a large enough size.
+		if size == 0 || size >= targetSize {
+			score += 1 << 30
+		}
+		if score > bestScore {
+			bestScore = score
+			best = candidate
+		}
+	}
+	return best
+}
+
+// Buckets a low-level scrape error into a coarse class suitable for persisting
+// alongside a domain's failure record.
+func classifyError(err error) string {
+	if err == nil {
+		return "unknown"
+	}
+	switch {
+	case strings.Contains(err.Error(), "timeout"), strings.Contains(err.Error(), "Timeout"):
+		return "timeout"
+	case strings.Contains(err.Error(), "no such host"):
+		return "dns"
+	case strings.Contains(err.Error(), "connection refused"):
+		return "connection-refused"
+	default:
+		return "request-error"
+	}
+}
+
+// Parses a comma-separated list of integers, e.g. "16,32,64", skipping any
+// entries that don't parse.
+func parseCSVInts(csv string) []int {
+	var values []int
+	for _, part := range strings.Split(csv, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			logrus.WithField("system", "favicon-collector").Warningf("Ignoring invalid size '%s'", part)
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// Parses a comma-separated list of strings, e.g. "png,webp", trimming whitespace.
+func parseCSVStrings(csv string) []string {
+	var values []string
+	for _, part := range strings.Split(csv, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		values = append(values, part)
+	}
+	return values
+}
+
+// Switches a request over to fetching the domain's root page for
+// <link rel="icon"> parsing (state 2), used both when /favicon.ico(/png)
+// 404s entirely and when it returns a 200 with non-image content (a custom
+// error page, a Cloudflare challenge page, etc.) that is just as much of a
+// dead end.
+func fallbackToHTMLParsing(collector *colly.Collector, r *colly.Response) {
+	htmlURL := *r.Request.URL
+	htmlURL.Path = "/"
+	htmlURL.RawQuery = ""
+	r.Ctx.Put("state", 2)
+	logrus.WithField("system", "favicon-collector").Debugf("Falling back to HTML parsing: %s", htmlURL.String())
+	collector.Request("GET", htmlURL.String(), nil, r.Ctx, conditionalHeadersFromContext(r.Ctx))
+}
+
+// Rebuilds the If-None-Match/If-Modified-Since headers for a --refresh
+// follow-up request (the HTML fallback fetch, or the <link rel=icon> fetch
+// it leads to) from the values stashed in ctx by the
+// original request, so a fallback hop doesn't silently drop them.
+func conditionalHeadersFromContext(ctx *colly.Context) http.Header {
+	headers := http.Header{}
+	if etag := ctx.Get("etag"); etag != "" {
+		headers.Set("If-None-Match", etag)
+	}
+	if lastModified := ctx.Get("lastModified"); lastModified != "" {
+		headers.Set("If-Modified-Since", lastModified)
+	}
+	return headers
+}
+
+// Records a permanent failure for domain in the scrape queue, if a domain was set.
+func markDomainFailed(scrapeQueue *queue.Store, domain string, errorClass string) {
+	if domain == "" {
+		return
+	}
+	if err := scrapeQueue.MarkFailed(domain, errorClass); err != nil {
+		logrus.WithField("system", "favicon-collector").Errorf("Failed to update queue for domain '%s': %s", domain, err)
+	}
+}
+
+// Appends a manifest entry for a non-successful outcome (failed or unchanged),
+// so downstream consumers can diff runs by domain without a missing line
+// being ambiguous between "skipped this run" and "attempted and failed". The
+// successful path appends its own, more detailed, record directly.
+func recordManifestOutcome(w *manifest.Writer, r *colly.Response, status string, errorClass string) {
+	domain := r.Ctx.Get("domain")
+	if domain == "" {
+		return
+	}
+	contentType := ""
+	if r.Headers != nil {
+		contentType = r.Headers.Get("Content-Type")
+	}
+	if err := w.Append(manifest.Record{
+		OriginalURL:  r.Ctx.Get("originalURL"),
+		Domain:       domain,
+		FinalURL:     r.Request.URL.String(),
+		HTTPStatus:   r.StatusCode,
+		ContentType:  contentType,
+		ByteSize:     len(r.Body),
+		SourceMethod: r.Ctx.Get("method"),
+		Status:       status,
+		ErrorClass:   errorClass,
+		ScrapedAt:    time.Now(),
+	}); err != nil {
+		logrus.WithField("system", "favicon-collector").Errorf("Failed to append manifest entry for domain '%s': %s", domain, err)
+	}
+}
+
 func main() {
 	var err error
 
@@ -71,6 +346,15 @@ func main() {
 	minScore := flag.Int("minscore", 10, "minimum required score for items")
 	batchRequests := flag.Int("batch", 0, "batch requests")
 	parallelRequests := flag.Int("parallel", 100, "parallel requests")
+	queueDatabasePath := flag.String("queuedb", "", "persistent scrape queue database (defaults to <outputdir>/queue.db)")
+	retryFailedAfter := flag.Duration("retry-failed-after", 7*24*time.Hour, "base cooldown before a permanently failed domain is retried again; doubles with each further failure, up to 16x")
+	minIconSize := flag.Int("min-icon-size", 16, "reject icons below this size (largest dimension, in pixels)")
+	targetIconSize := flag.Int("target-icon-size", 32, "preferred icon size (largest dimension, in pixels) when choosing between <link rel=icon> candidates")
+	normalizeEnabled := flag.Bool("normalize", false, "also write normalized PNG/WebP derivatives of every scraped icon")
+	normalizeSizesFlag := flag.String("sizes", "16,32,64,128", "comma-separated normalized icon sizes, in pixels")
+	normalizeFormatsFlag := flag.String("formats", "png", "comma-separated normalized icon output formats (png, webp)")
+	keepOriginal := flag.Bool("keep-original", true, "keep the originally scraped icon file alongside its normalized derivatives")
+	refreshMode := flag.Bool("refresh", false, "re-check previously succeeded domains using conditional (ETag/Last-Modified) requests")
 	flag.Parse()
 
 	// Set the log level
@@ -106,6 +390,35 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Open the persistent scrape queue, so resuming a prior run skips domains
+	// that already succeeded or that recently failed permanently
+	if *queueDatabasePath == "" {
+		*queueDatabasePath = filepath.Join(*outputStoragePath, "queue.db")
+	}
+	if err = os.MkdirAll(filepath.Dir(*queueDatabasePath), 0755); err != nil {
+		logrus.WithField("system", "favicon-collector").Errorf("Failed to create queue database directory: %s", err)
+		os.Exit(2)
+	}
+	scrapeQueue, err := queue.Open(*queueDatabasePath)
+	if err != nil {
+		logrus.WithField("system", "favicon-collector").Errorf("Failed to open queue database '%s': %s", *queueDatabasePath, err)
+		os.Exit(2)
+	}
+	defer scrapeQueue.Close()
+
+	manifestWriter, err := manifest.Create(filepath.Join(*outputStoragePath, "manifest.jsonl"))
+	if err != nil {
+		logrus.WithField("system", "favicon-collector").Errorf("Failed to open manifest: %s", err)
+		os.Exit(2)
+	}
+	defer manifestWriter.Close()
+	runStartedAt := time.Now()
+
+	normalizeOptions := normalize.Options{
+		Sizes:   parseCSVInts(*normalizeSizesFlag),
+		Formats: parseCSVStrings(*normalizeFormatsFlag),
+	}
+
 	// Stats
 	statsEntries := 0
 	statsDuplicates := 0
@@ -114,6 +427,7 @@ func main() {
 	statsScrapesSuccess := 0
 	statsScrapesSkipped := 0
 	statsScrapesFailed := 0
+	statsScrapesUnchanged := 0
 
 	// @security
 	// Maximum body (file) size, should be reasonable
@@ -140,16 +454,40 @@ func main() {
 		}
 		logrus.WithField("system", "favicon-collector").Debugf("Error during crawling for URL %s: %s", r.Request.URL.String(), err)
 
+		// colly hands every status of 203 and above to this handler, including the
+		// 304 a --refresh conditional request gets back for an unchanged icon
+		if r.StatusCode == http.StatusNotModified {
+			domain := r.Ctx.Get("domain")
+			if domain != "" {
+				if markErr := scrapeQueue.MarkUnchanged(domain); markErr != nil {
+					logrus.WithField("system", "favicon-collector").Errorf("Failed to update queue for domain '%s': %s", domain, markErr)
+				}
+			}
+			recordManifestOutcome(manifestWriter, r, "unchanged", "")
+			statsScrapesUnchanged = statsScrapesUnchanged + 1
+			return
+		}
+
 		// If Not Found, try alternative paths
 		if r.StatusCode == 404 {
+			state, _ := r.Ctx.GetAny("state").(int)
+
 			if r.Ctx.GetAny("state") == nil {
 				// Retry with alternative path
 				r.Request.URL.Path = `/favicon.png`
 				r.Ctx.Put("state", 1)
+				r.Ctx.Put("method", "favicon.png")
 				logrus.WithField("system", "favicon-collector").Debugf("Retrying alternative URL: %s", r.Request.URL.String())
 				r.Request.Retry()
 				return
 			}
+
+			if state == 1 {
+				// Both well-known paths are gone; fall back to parsing the root page's HTML
+				// for <link rel="icon"> and friends.
+				fallbackToHTMLParsing(collector, r)
+				return
+			}
 		}
 
 		// If this is https, retry once with http scheme
@@ -161,6 +499,9 @@ func main() {
 			return
 		} else {
 			// Already http scheme, permanent failure
+			errorClass := classifyError(err)
+			markDomainFailed(scrapeQueue, r.Ctx.Get("domain"), errorClass)
+			recordManifestOutcome(manifestWriter, r, "failed", errorClass)
 
 			// Increment stats
 			statsScrapesFailed = statsScrapesFailed + 1
@@ -172,6 +513,19 @@ func main() {
 			logrus.WithField("system", "favicon-collector").Debugf("Null response (%s)", err)
 			return
 		}
+		if r.StatusCode == http.StatusNotModified {
+			// --refresh conditional request confirmed the icon hasn't changed
+			domain := r.Ctx.Get("domain")
+			logrus.WithField("system", "favicon-collector").Debugf("Not modified for URL %s", r.Request.URL.String())
+			if domain != "" {
+				if markErr := scrapeQueue.MarkUnchanged(domain); markErr != nil {
+					logrus.WithField("system", "favicon-collector").Errorf("Failed to update queue for domain '%s': %s", domain, markErr)
+				}
+			}
+			recordManifestOutcome(manifestWriter, r, "unchanged", "")
+			statsScrapesUnchanged = statsScrapesUnchanged + 1
+			return
+		}
 		if len(r.Body) == 0 {
 			logrus.WithField("system", "favicon-collector").Debugf("Empty response for URL %s", r.Request.URL.String())
 			return
@@ -181,14 +535,132 @@ func main() {
 		}
 		logrus.WithField("system", "favicon-collector").Debugf("Got response for URL %s", r.Request.URL.String())
 
-		// Check for image
 		contentType := r.Headers.Get("Content-Type")
+		state, _ := r.Ctx.GetAny("state").(int)
+
+		// This is the root page fetched as a fallback after /favicon.ico and /favicon.png
+		// both 404'd, or after either returned non-image content; parse it for icon link
+		// tags instead of treating it as the icon itself.
+		if state == 2 {
+			if strings.Index(contentType, "html") == -1 {
+				logrus.WithField("system", "favicon-collector").Warningf("Expected HTML for fallback parsing, got %s for URL %s", contentType, r.Request.URL.String())
+				markDomainFailed(scrapeQueue, r.Ctx.Get("domain"), "unexpected-content-type")
+				recordManifestOutcome(manifestWriter, r, "failed", "unexpected-content-type")
+				statsScrapesFailed = statsScrapesFailed + 1
+				return
+			}
+
+			candidates := parseIconCandidates(r.Body, r.Request.URL)
+			best := selectBestIconCandidate(candidates, *targetIconSize)
+			if best == nil {
+				logrus.WithField("system", "favicon-collector").Debugf("No icon link tags found on %s", r.Request.URL.String())
+				markDomainFailed(scrapeQueue, r.Ctx.Get("domain"), "no-icon-candidates")
+				recordManifestOutcome(manifestWriter, r, "failed", "no-icon-candidates")
+				statsScrapesFailed = statsScrapesFailed + 1
+				return
+			}
+
+			logrus.WithField("system", "favicon-collector").Debugf("Found icon candidate via HTML parsing: %s", best.URL)
+			r.Ctx.Put("state", 3)
+			r.Ctx.Put("method", best.Source)
+			collector.Request("GET", best.URL, nil, r.Ctx, conditionalHeadersFromContext(r.Ctx))
+			return
+		}
+
+		// Check for image
 		if strings.Index(contentType, "image") > -1 {
 			// Save file
 			path := r.Ctx.Get("path")
 			if path != "" {
+				domain := r.Ctx.Get("domain")
+				bodySum := sha256.Sum256(r.Body)
+				bodyHash := hex.EncodeToString(bodySum[:])
+
+				// In --refresh mode, a 200 can still mean "unchanged" if the server
+				// doesn't honor conditional headers; only rewrite the file and
+				// derivatives if the body actually changed
+				if *refreshMode && domain != "" {
+					if previous, found, getErr := scrapeQueue.Get(domain); getErr == nil && found && previous.SHA256 == bodyHash {
+						logrus.WithField("system", "favicon-collector").Debugf("Body unchanged for URL %s", r.Request.URL.String())
+						if markErr := scrapeQueue.MarkUnchanged(domain); markErr != nil {
+							logrus.WithField("system", "favicon-collector").Errorf("Failed to update queue for domain '%s': %s", domain, markErr)
+						}
+						recordManifestOutcome(manifestWriter, r, "unchanged", "")
+						statsScrapesUnchanged = statsScrapesUnchanged + 1
+						return
+					}
+				}
+
+				// Sniff the true format and dimensions, since servers routinely mislabel
+				// HTML error pages as images, or serve a PNG/SVG from a ".ico" path.
+				format, formatErr := iconformat.Detect(r.Body)
+				if formatErr != nil {
+					logrus.WithField("system", "favicon-collector").Warningf("Rejecting undecodable image for URL %s: %s", r.Request.URL.String(), formatErr)
+					markDomainFailed(scrapeQueue, domain, "undecodable-image")
+					recordManifestOutcome(manifestWriter, r, "failed", "undecodable-image")
+					statsScrapesFailed = statsScrapesFailed + 1
+					return
+				}
+				if format.Width > 0 && format.Height > 0 {
+					maxDimension := format.Width
+					if format.Height > maxDimension {
+						maxDimension = format.Height
+					}
+					if maxDimension < *minIconSize {
+						logrus.WithField("system", "favicon-collector").Debugf("Rejecting %dx%d icon below minimum size for URL %s", format.Width, format.Height, r.Request.URL.String())
+						markDomainFailed(scrapeQueue, domain, "below-minimum-size")
+						recordManifestOutcome(manifestWriter, r, "failed", "below-minimum-size")
+						statsScrapesFailed = statsScrapesFailed + 1
+						return
+					}
+				}
+
+				// Save under the true extension rather than the ".ico" the path was
+				// planned with
+				path = strings.TrimSuffix(path, filepath.Ext(path)) + "." + format.Ext
 				r.Save(path)
 
+				if *normalizeEnabled {
+					if normErr := normalize.Run(domain, path, format.Ext, *outputStoragePath, normalizeOptions); normErr != nil {
+						logrus.WithField("system", "favicon-collector").Errorf("Failed to normalize icon for URL %s: %s", r.Request.URL.String(), normErr)
+					}
+					if !*keepOriginal {
+						if rmErr := os.Remove(path); rmErr != nil {
+							logrus.WithField("system", "favicon-collector").Errorf("Failed to remove original icon '%s': %s", path, rmErr)
+						}
+					}
+				}
+
+				if domain != "" {
+					meta := queue.FetchMetadata{
+						ETag:         r.Headers.Get("ETag"),
+						LastModified: r.Headers.Get("Last-Modified"),
+						FinalURL:     r.Request.URL.String(),
+						SHA256:       bodyHash,
+					}
+					if markErr := scrapeQueue.MarkSucceeded(domain, meta); markErr != nil {
+						logrus.WithField("system", "favicon-collector").Errorf("Failed to update queue for domain '%s': %s", domain, markErr)
+					}
+				}
+
+				if manifestErr := manifestWriter.Append(manifest.Record{
+					OriginalURL:  r.Ctx.Get("originalURL"),
+					Domain:       domain,
+					FinalURL:     r.Request.URL.String(),
+					HTTPStatus:   r.StatusCode,
+					ContentType:  contentType,
+					ByteSize:     len(r.Body),
+					SHA256:       bodyHash,
+					Format:       format.Ext,
+					Width:        format.Width,
+					Height:       format.Height,
+					SourceMethod: r.Ctx.Get("method"),
+					Status:       "succeeded",
+					ScrapedAt:    time.Now(),
+				}); manifestErr != nil {
+					logrus.WithField("system", "favicon-collector").Errorf("Failed to append manifest entry for domain '%s': %s", domain, manifestErr)
+				}
+
 				// Increment stats
 				statsScrapesSuccess = statsScrapesSuccess + 1
 				return
@@ -197,8 +669,19 @@ func main() {
 				logrus.WithField("system", "favicon-collector").Errorf("Invalid context for URL %s", r.Request.URL.String())
 				os.Exit(2)
 			}
+		} else if state == 0 || state == 1 {
+			// /favicon.ico or /favicon.png "succeeded" with a 200 but non-image
+			// content (a custom error page, a Cloudflare challenge page, etc.);
+			// that's just as much a dead end as a 404, so fall back to HTML
+			// link-tag parsing the same way the OnError 404 handler does.
+			logrus.WithField("system", "favicon-collector").Debugf("Got non-image Content-Type %s for URL %s, falling back to HTML parsing", contentType, r.Request.URL.String())
+			fallbackToHTMLParsing(collector, r)
 		} else {
 			logrus.WithField("system", "favicon-collector").Warningf("Got unexpected Content-Type for URL %s: %s", r.Request.URL.String(), contentType)
+			domain := r.Ctx.Get("domain")
+			markDomainFailed(scrapeQueue, domain, "unexpected-content-type")
+			recordManifestOutcome(manifestWriter, r, "failed", "unexpected-content-type")
+			statsScrapesFailed = statsScrapesFailed + 1
 		}
 	})
 
@@ -265,35 +748,67 @@ func main() {
 			// Construct output favicon path
 			pathOutput := filepath.Join(*outputStoragePath, domain + ".ico")
 
-			// Check if not exists in output storage
-			domainExists := false
-			{
-				if _, err := os.Stat(pathOutput); err == nil {
-					domainExists = true
-				} else if errors.Is(err, fs.ErrNotExist) {
-					domainExists = false
-				} else {
-					// File error
-					logrus.WithField("system", "favicon-collector").Errorf("Failed to stat file '%s': %s", pathOutput, err)
-					continue
+			// Check the persistent queue: skip domains that already succeeded (unless
+			// --refresh is asking us to re-check them), or that failed permanently
+			// within the retry-failed-after cooldown
+			record, found, err := scrapeQueue.Get(domain)
+			if err != nil {
+				logrus.WithField("system", "favicon-collector").Errorf("Failed to query queue for domain '%s': %s", domain, err)
+				continue
+			}
+			skip := false
+			if found {
+				switch record.Status {
+				case queue.StatusSucceeded:
+					skip = !*refreshMode
+				case queue.StatusFailed:
+					skip, err = scrapeQueue.ShouldSkip(domain, *retryFailedAfter)
+					if err != nil {
+						logrus.WithField("system", "favicon-collector").Errorf("Failed to query queue for domain '%s': %s", domain, err)
+						continue
+					}
 				}
 			}
 
 			totalRequests = totalRequests + 1
-			if !domainExists {
+			if !skip {
 				// Extract original domain without sanitation, so we retain hopefully a working original url to crawl
 				domainOriginal := extractDomainFromURL(url)
 
-				// Construct URL
-				urlFavicon := `https://` + domainOriginal + `/favicon.ico`
+				// Construct URL: a --refresh re-check of a domain we already resolved an
+				// icon for goes straight back to that resolved URL rather than restarting
+				// from /favicon.ico, so the ETag/Last-Modified we stored for it still applies
+				requestURL := `https://` + domainOriginal + `/favicon.ico`
+				requestMethod := "favicon.ico"
+				isRefreshOfResolvedURL := *refreshMode && found && record.Status == queue.StatusSucceeded && record.FinalURL != ""
+				if isRefreshOfResolvedURL {
+					requestURL = record.FinalURL
+					requestMethod = "refresh"
+				}
 
 				// Perform the crawl for the favicon
 				ctx := colly.NewContext()
 		    	ctx.Put("path", pathOutput)
-				logrus.WithField("system", "favicon-collector").Debugf("Planning scrape: %s", urlFavicon)
+				ctx.Put("domain", domain)
+				ctx.Put("originalURL", url)
+				ctx.Put("method", requestMethod)
+				if err := scrapeQueue.MarkInFlight(domain); err != nil {
+					logrus.WithField("system", "favicon-collector").Errorf("Failed to update queue for domain '%s': %s", domain, err)
+				}
+				logrus.WithField("system", "favicon-collector").Debugf("Planning scrape: %s", requestURL)
 				headers := http.Header{}
 				headers.Set("Origin", `https//` + domainOriginal + `/`)
-				collector.Request("GET", urlFavicon, nil, ctx, headers)
+				if *refreshMode && found && record.Status == queue.StatusSucceeded {
+					if record.ETag != "" {
+						headers.Set("If-None-Match", record.ETag)
+						ctx.Put("etag", record.ETag)
+					}
+					if record.LastModified != "" {
+						headers.Set("If-Modified-Since", record.LastModified)
+						ctx.Put("lastModified", record.LastModified)
+					}
+				}
+				collector.Request("GET", requestURL, nil, ctx, headers)
 				currentRequests = currentRequests + 1
 
 				// Increment stats
@@ -308,7 +823,7 @@ func main() {
 				logrus.WithField("system", "favicon-collector").Infof("%d requests issued, batch size %d, waiting for batch jobs to finish...", totalRequests, *batchRequests)
 				logrus.WithField("system", "favicon-collector").Infof("Valid domains: %d (excluding %d duplicate)", statsEntries, statsDuplicates)
 				logrus.WithField("system", "favicon-collector").Infof("Planned scrapes: %d (excluding %d skipped)", statsScrapesPlanned, statsScrapesSkipped)
-				logrus.WithField("system", "favicon-collector").Infof("Successful scrapes: %d (excluding %d failed)", statsScrapesSuccess, statsScrapesFailed)
+				logrus.WithField("system", "favicon-collector").Infof("Successful scrapes: %d (excluding %d failed, %d unchanged)", statsScrapesSuccess, statsScrapesFailed, statsScrapesUnchanged)
 				collector.Wait()
 				currentRequests = 0
 			}
@@ -324,7 +839,24 @@ func main() {
 		logrus.WithField("system", "favicon-collector").Infof("Finished scraping")
 		logrus.WithField("system", "favicon-collector").Infof("Valid domains: %d (excluding %d duplicate)", statsEntries, statsDuplicates)
 		logrus.WithField("system", "favicon-collector").Infof("Planned scrapes: %d (excluding %d skipped)", statsScrapesPlanned, statsScrapesSkipped)
-		logrus.WithField("system", "favicon-collector").Infof("Successful scrapes: %d (excluding %d failed)", statsScrapesSuccess, statsScrapesFailed)
+		logrus.WithField("system", "favicon-collector").Infof("Successful scrapes: %d (excluding %d failed, %d unchanged)", statsScrapesSuccess, statsScrapesFailed, statsScrapesUnchanged)
+
+		summaryPath := filepath.Join(*outputStoragePath, "run-summary.json")
+		summary := manifest.Summary{
+			StartedAt:  runStartedAt,
+			FinishedAt: time.Now(),
+			Entries:    statsEntries,
+			Duplicates: statsDuplicates,
+			Rows:       statsRows,
+			Planned:    statsScrapesPlanned,
+			Succeeded:  statsScrapesSuccess,
+			Skipped:    statsScrapesSkipped,
+			Failed:     statsScrapesFailed,
+			Unchanged:  statsScrapesUnchanged,
+		}
+		if err := manifest.WriteSummary(summaryPath, summary); err != nil {
+			logrus.WithField("system", "favicon-collector").Errorf("Failed to write run summary: %s", err)
+		}
 	}
 }
 